@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package cgroup correlates cgroup v2 IDs, as reported by BPF programs via
+// bpf_get_current_cgroup_id(), with the Pod/Container/Unit identity implied
+// by their cgroupfs path. It watches cgroupfs for create/destroy events so
+// that lookups stay correct for short-lived processes whose PID may already
+// be recycled by the time a listener inspects the event.
+package cgroup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cilium/tetragon/pkg/logger"
+)
+
+// DefaultRoot is the standard cgroup v2 mountpoint.
+const DefaultRoot = "/sys/fs/cgroup"
+
+// Info carries the Kubernetes identity associated with a cgroup.
+type Info struct {
+	Pod       string
+	Container string
+	Unit      string
+}
+
+// Resolver maps a cgroup v2 ID to the Pod/Container/Unit it belongs to.
+type Resolver interface {
+	Resolve(cgroupID uint64) (Info, bool)
+}
+
+// manager watches cgroupfs below root and keeps an in-memory
+// cgroupID -> Info map up to date as cgroups are created and destroyed.
+type manager struct {
+	mu   sync.RWMutex
+	byID map[uint64]Info
+	// idByPath records the id a path resolved to when it was added, so
+	// remove can evict it on destroy without re-stating a path that the
+	// kernel has already unlinked by the time the fsnotify Remove event
+	// is delivered.
+	idByPath map[string]uint64
+	root     string
+	watcher  *fsnotify.Watcher
+	log      logrus.FieldLogger
+}
+
+// NewResolver creates a Resolver rooted at root (normally DefaultRoot),
+// performing an initial walk of existing cgroups before returning. Call
+// Start to begin watching for subsequent create/destroy events.
+func NewResolver(root string) (*manager, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating cgroup fsnotify watcher failed: %w", err)
+	}
+
+	m := &manager{
+		byID:     make(map[uint64]Info),
+		idByPath: make(map[string]uint64),
+		root:     root,
+		watcher:  watcher,
+		log:      logger.GetLogger(),
+	}
+
+	if err := m.scan(); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("scanning cgroup root %q failed: %w", root, err)
+	}
+
+	return m, nil
+}
+
+// Start watches cgroupfs for create/destroy events until ctx is cancelled.
+func (m *manager) Start(ctx context.Context) error {
+	if err := m.watcher.Add(m.root); err != nil {
+		return fmt.Errorf("watching cgroup root %q failed: %w", m.root, err)
+	}
+
+	go func() {
+		defer m.watcher.Close()
+		for {
+			select {
+			case event, ok := <-m.watcher.Events:
+				if !ok {
+					return
+				}
+				m.handleEvent(event)
+			case err, ok := <-m.watcher.Errors:
+				if !ok {
+					return
+				}
+				m.log.WithError(err).Warn("cgroup watcher error")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Resolve implements Resolver.
+func (m *manager) Resolve(cgroupID uint64) (Info, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	info, ok := m.byID[cgroupID]
+	return info, ok
+}
+
+func (m *manager) handleEvent(event fsnotify.Event) {
+	switch {
+	case event.Op&fsnotify.Create != 0:
+		m.add(event.Name)
+	case event.Op&fsnotify.Remove != 0:
+		m.remove(event.Name)
+	}
+}
+
+func (m *manager) add(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.IsDir() {
+		return
+	}
+
+	id, err := cgroupID(path)
+	if err != nil {
+		m.log.WithError(err).WithField("path", path).Debug("reading cgroup id failed")
+		return
+	}
+
+	m.mu.Lock()
+	m.byID[id] = infoFromPath(path)
+	m.idByPath[path] = id
+	m.mu.Unlock()
+
+	// Subdirectories (e.g. a systemd scope nested under a pod slice) need
+	// their own watch to be notified of their own create/destroy events.
+	_ = m.watcher.Add(path)
+}
+
+// remove evicts path's cgroup. It runs off the fsnotify Remove event,
+// which fires after the directory has already been unlinked, so it
+// cannot re-stat path to recover the id the way add does; it looks the id
+// up from idByPath instead.
+func (m *manager) remove(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.idByPath[path]
+	if !ok {
+		return
+	}
+	delete(m.idByPath, path)
+	delete(m.byID, id)
+}
+
+func (m *manager) scan() error {
+	return filepath.WalkDir(m.root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		m.add(path)
+		return nil
+	})
+}
+
+// cgroupID returns the cgroup v2 ID for path. On cgroup v2, cgroupfs
+// exposes this as the directory's inode number, the same value BPF
+// programs observe through bpf_get_current_cgroup_id().
+func cgroupID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Ino, nil
+}
+
+// podSliceRE matches the path segment kubelet names after a specific pod,
+// in either the systemd cgroup driver's form (.../kubepods-burstable-
+// pod<UID>.slice, UID with underscores) or the cgroupfs driver's (a bare
+// pod<UID> directory, UID with dashes). It requires "pod" to start the
+// segment or immediately follow a "-", so it doesn't also match the
+// "kubepods[-qos].slice" segments above it in the same path, which merely
+// contain "pod" as a substring of "kubepods".
+var podSliceRE = regexp.MustCompile(`(?:^|-)pod[0-9a-fA-F_-]+(?:\.slice)?$`)
+
+// infoFromPath extracts Kubernetes identity from a kubelet-managed cgroup
+// path, e.g.
+//
+//	kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<UID>.slice/cri-containerd-<ID>.scope
+func infoFromPath(path string) Info {
+	info := Info{Unit: filepath.Base(path)}
+
+	for _, part := range strings.Split(path, string(os.PathSeparator)) {
+		switch {
+		case podSliceRE.MatchString(part):
+			info.Pod = part
+		case strings.HasSuffix(part, ".scope"):
+			info.Container = strings.TrimSuffix(part, ".scope")
+		}
+	}
+
+	return info
+}
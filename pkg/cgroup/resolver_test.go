@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInfoFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want Info
+	}{
+		{
+			path: "/sys/fs/cgroup/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-abcd.scope",
+			want: Info{
+				Pod:       "kubepods-burstable-pod1234.slice",
+				Container: "cri-containerd-abcd",
+				Unit:      "cri-containerd-abcd.scope",
+			},
+		},
+		{
+			path: "/sys/fs/cgroup/system.slice/containerd.service",
+			want: Info{
+				Unit: "containerd.service",
+			},
+		},
+		{
+			// "kubepods.slice" and "kubepods-besteffort.slice" both
+			// contain "pod" as a substring of "kubepods" and must not
+			// be mistaken for the per-pod slice itself.
+			path: "/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice/cri-containerd-xyz.scope",
+			want: Info{
+				Container: "cri-containerd-xyz",
+				Unit:      "cri-containerd-xyz.scope",
+			},
+		},
+		{
+			// cgroupfs driver: a bare pod<UID> directory, no ".slice".
+			path: "/sys/fs/cgroup/kubepods/burstable/pod1234-5678-90ab-cdef/cri-containerd-abcd.scope",
+			want: Info{
+				Pod:       "pod1234-5678-90ab-cdef",
+				Container: "cri-containerd-abcd",
+				Unit:      "cri-containerd-abcd.scope",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := infoFromPath(tt.path)
+		if got != tt.want {
+			t.Errorf("infoFromPath(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCgroupID(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "child.scope")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+
+	id, err := cgroupID(sub)
+	if err != nil {
+		t.Fatalf("cgroupID failed: %v", err)
+	}
+	if id == 0 {
+		t.Fatalf("cgroupID returned 0 for an existing directory")
+	}
+
+	if _, err := cgroupID(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("cgroupID succeeded for a nonexistent path")
+	}
+}
+
+func TestManagerAddRemove(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewResolver(root)
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	sub := filepath.Join(root, "kubepods-burstable-podabc.slice", "cri-containerd-xyz.scope")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	m.add(sub)
+
+	id, err := cgroupID(sub)
+	if err != nil {
+		t.Fatalf("cgroupID failed: %v", err)
+	}
+
+	if _, ok := m.Resolve(id); !ok {
+		t.Fatalf("Resolve(%d) missing after add", id)
+	}
+
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatalf("removing cgroup dir failed: %v", err)
+	}
+	m.remove(sub)
+
+	if _, ok := m.Resolve(id); ok {
+		t.Fatalf("Resolve(%d) still present after remove", id)
+	}
+}
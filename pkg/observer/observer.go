@@ -16,16 +16,18 @@ import (
 	"time"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/perf"
 	"github.com/cilium/tetragon/pkg/api/readyapi"
 	"github.com/cilium/tetragon/pkg/bpf"
+	"github.com/cilium/tetragon/pkg/cgroup"
 	"github.com/cilium/tetragon/pkg/logger"
 	"github.com/cilium/tetragon/pkg/metrics/errormetrics"
 	"github.com/cilium/tetragon/pkg/metrics/opcodemetrics"
 	"github.com/cilium/tetragon/pkg/metrics/ringbufmetrics"
 	"github.com/cilium/tetragon/pkg/metrics/ringbufqueuemetrics"
+	"github.com/cilium/tetragon/pkg/observer/sampling"
 	"github.com/cilium/tetragon/pkg/option"
 	"github.com/cilium/tetragon/pkg/reader/notify"
+	"github.com/cilium/tetragon/pkg/runtimetune"
 	"github.com/cilium/tetragon/pkg/sensors"
 	"github.com/cilium/tetragon/pkg/sensors/config/confmap"
 
@@ -44,6 +46,24 @@ var (
 
 type Event notify.Message
 
+// CgroupAnnotatable is implemented by notify.Message events that carry a
+// kernel cgroup v2 ID and can be enriched with the Pod/Container/Unit
+// identity it resolves to. receiveEvent uses this to enrich events before
+// listeners are notified, giving reliable attribution even when the
+// originating process is too short-lived for a PID-based lookup to land.
+type CgroupAnnotatable interface {
+	EventCgroupID() uint64
+	SetCgroupInfo(pod, container, unit string)
+}
+
+// SampleRatioAnnotatable is implemented by notify.Message events that can
+// carry the effective sampling ratio applied to their opcode, so
+// downstream consumers can extrapolate true counts from what they
+// actually received.
+type SampleRatioAnnotatable interface {
+	SetSampleRatio(ratio float64)
+}
+
 func RegisterEventHandlerAtInit(ev uint8, handler func(r *bytes.Reader) ([]Event, error)) {
 	eventHandler[ev] = handler
 }
@@ -125,6 +145,15 @@ func (k *Observer) receiveEvent(data []byte) {
 		timer = time.Now()
 	}
 
+	if k.sampler != nil {
+		op := data[0]
+		if !k.sampler.Allow(op) {
+			opcodemetrics.OpDroppedInc(int(op))
+			return
+		}
+		opcodemetrics.OpSampledInc(int(op))
+	}
+
 	op, events, err := HandlePerfData(data)
 	opcodemetrics.OpTotalInc(int(op))
 	if err != nil {
@@ -141,6 +170,8 @@ func (k *Observer) receiveEvent(data []byte) {
 		}
 	}
 	for _, event := range events {
+		k.annotateCgroupInfo(event)
+		k.annotateSampleRatio(event, op)
 		k.observerListeners(event)
 	}
 	if option.Config.EnableMsgHandlingLatency {
@@ -148,6 +179,43 @@ func (k *Observer) receiveEvent(data []byte) {
 	}
 }
 
+// annotateCgroupInfo enriches event with Pod/Container/Unit identity when
+// the cgroup correlation subsystem is enabled and the event implements
+// CgroupAnnotatable.
+func (k *Observer) annotateCgroupInfo(event notify.Message) {
+	if k.cgroupResolver == nil {
+		return
+	}
+
+	annotatable, ok := event.(CgroupAnnotatable)
+	if !ok {
+		return
+	}
+
+	info, ok := k.cgroupResolver.Resolve(annotatable.EventCgroupID())
+	if !ok {
+		return
+	}
+
+	annotatable.SetCgroupInfo(info.Pod, info.Container, info.Unit)
+}
+
+// annotateSampleRatio records the current sampling ratio for op on event
+// when opcode sampling is enabled and the event implements
+// SampleRatioAnnotatable.
+func (k *Observer) annotateSampleRatio(event notify.Message, op byte) {
+	if k.sampler == nil {
+		return
+	}
+
+	annotatable, ok := event.(SampleRatioAnnotatable)
+	if !ok {
+		return
+	}
+
+	annotatable.SetSampleRatio(k.sampler.Ratio(op))
+}
+
 // Gets final size for single perf ring buffer rounded from
 // passed size argument (kindly borrowed from ebpf/cilium)
 func perfBufferSize(perCPUBuffer int) int {
@@ -177,6 +245,9 @@ func sizeWithSuffix(size int) string {
 	return fmt.Sprintf("%d%s", size, suffix[i])
 }
 
+// getRBSize computes the per-unit buffer size to request from the kernel,
+// where a unit is a CPU for a perf event array and the whole map for a BPF
+// ring buffer (cpus == 1 in that case, see RunEvents).
 func (k *Observer) getRBSize(cpus int) int {
 	var size int
 
@@ -215,86 +286,199 @@ func (k *Observer) RunEvents(stopCtx context.Context, ready func()) error {
 	}
 	defer perfMap.Close()
 
-	rbSize := k.getRBSize(int(perfMap.MaxEntries()))
-	perfReader, err := perf.NewReader(perfMap, rbSize)
+	// A BPF_MAP_TYPE_RINGBUF map is a single buffer shared by all CPUs, so
+	// it is sized directly rather than per-CPU like the perf event array.
+	// For the perf event array, size off the cgroup's effective CPU count
+	// rather than the map's CPU dimension, so RBSizeTotal isn't divided
+	// across CPUs the container cannot actually schedule on.
+	cpus := int(perfMap.MaxEntries())
+	if k.effectiveCPUs > 0 && k.effectiveCPUs < cpus {
+		cpus = k.effectiveCPUs
+	}
+	ringBuf := perfMap.Type() == ebpf.RingBuf
+	if ringBuf {
+		cpus = 1
+	}
+
+	// spawn starts a new reader/eventsQueue generation and its read and
+	// process goroutines, returning the reader and a WaitGroup that
+	// completes once both goroutines have fully drained and exited.
+	spawn := func(rbSize, queueSize int) (bpfEventsReader, *sync.WaitGroup, error) {
+		reader, err := newBpfEventsReader(k, perfMap, rbSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		eventsQueue := make(chan bpfRecord, queueSize)
+
+		var genWG sync.WaitGroup
+		genWG.Add(2)
+		go k.readEvents(stopCtx, reader, eventsQueue, &genWG)
+		go k.processEvents(stopCtx, eventsQueue, &genWG)
+
+		return reader, &genWG, nil
+	}
 
+	currentRBSize := k.getRBSize(cpus)
+	reader, genWG, err := spawn(currentRBSize, k.getRBQueueSize())
 	if err != nil {
-		return fmt.Errorf("creating perf array reader failed: %w", err)
+		return err
 	}
 
 	// Inform caller that we're about to start processing events.
 	k.observerListeners(&readyapi.MsgTetragonReady{})
 	ready()
 
-	// We spawn go routine to read and process perf events,
-	// connected with main app through eventsQueue channel.
-	eventsQueue := make(chan *perf.Record, k.getRBQueueSize())
-
 	// Listeners are ready and about to start reading from perf reader, tell
 	// user everything is ready.
 	k.log.Info("Listening for events...")
 
-	// Start reading records from the perf array. Reads until the reader is closed.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	defer wg.Wait()
+	// Loading default program consumes some memory lets kick GC to give
+	// this back to the OS (K8s).
 	go func() {
-		defer wg.Done()
-		for stopCtx.Err() == nil {
-			record, err := perfReader.Read()
+		runtime.GC()
+	}()
+
+	// The control surface for Reconfigure: a SIGHUP re-applies the sizes
+	// currently in option.Config, and, when configured, a feedback loop
+	// grows the ring buffer on its own once it observes sustained loss.
+	// A gRPC server elsewhere in the stack can reach the same mechanism
+	// by calling Observer.ReconfigureRingBuffer.
+	k.WatchSIGHUP(stopCtx, cpus)
+	if option.Config.RBAutoGrowCeiling > 0 {
+		if ringBuf {
+			// BPF_MAP_TYPE_RINGBUF is sized once at map creation, so
+			// there is nothing for auto-grow to actually resize here;
+			// running it anyway would report successful grows while
+			// the kernel-side buffer never changes.
+			k.log.Warn("RBAutoGrow is configured but has no effect on a BPF_MAP_TYPE_RINGBUF map, whose size is fixed at creation time; not starting it")
+		} else {
+			k.WatchAutoGrow(stopCtx, AutoGrowConfig{
+				Interval:      option.Config.RBAutoGrowInterval,
+				LossThreshold: option.Config.RBAutoGrowLossThreshold,
+				GrowthFactor:  option.Config.RBAutoGrowFactor,
+				Ceiling:       option.Config.RBAutoGrowCeiling,
+			}, cpus)
+		}
+	}
+
+	return k.runReconfigureLoop(stopCtx, ringBuf, currentRBSize, reader, genWG, spawn)
+}
+
+// bpfReaderSpawner starts a new reader/eventsQueue generation, matching
+// the spawn closure RunEvents builds around the pinned BPF map; factored
+// out as its own type so runReconfigureLoop can be driven by a fake
+// implementation in tests, without a real pinned map.
+type bpfReaderSpawner func(rbSize, queueSize int) (bpfEventsReader, *sync.WaitGroup, error)
+
+// runReconfigureLoop drains k.reconfigCh, swapping to a new reader/
+// eventsQueue generation via spawn for each request, until stopCtx is
+// cancelled, at which point it closes reader and returns. ringBuf and
+// currentRBSize let it refuse a ring-buffer resize it cannot actually
+// perform, see newBpfEventsReader.
+func (k *Observer) runReconfigureLoop(stopCtx context.Context, ringBuf bool, currentRBSize int, reader bpfEventsReader, genWG *sync.WaitGroup, spawn bpfReaderSpawner) error {
+	for {
+		select {
+		case req := <-k.reconfigCh:
+			rbSize := req.rbSize
+			if ringBuf && rbSize != currentRBSize {
+				// Resizing a BPF_MAP_TYPE_RINGBUF map would require
+				// recreating it, not just its reader; ringbuf.NewReader
+				// takes no size argument and silently ignores rbSize.
+				// Only eventsQueue can actually change size here.
+				k.log.WithField("requested", rbSize).WithField("effective", currentRBSize).
+					Warn("Ring buffer size is fixed at creation time for BPF_MAP_TYPE_RINGBUF; ignoring requested resize, only eventsQueue will be resized")
+				rbSize = currentRBSize
+			}
+
+			k.log.WithField("rbSize", rbSize).WithField("queueSize", req.queueSize).
+				Info("Reconfiguring ring buffer")
+
+			// BPF_MAP_TYPE_RINGBUF has a single shared consumer
+			// position: two readers open on the same map at once would
+			// race to advance it and silently split/drop records
+			// between them. Stop the current generation and wait for
+			// it to fully drain before opening the next one on the
+			// same pinned map, rather than running both at once.
+			if err := reader.Close(); err != nil {
+				k.log.WithError(err).Debug("closing previous reader failed")
+			}
+			genWG.Wait()
+
+			var err error
+			reader, genWG, err = spawn(rbSize, req.queueSize)
 			if err != nil {
-				// NOTE(JM and Djalal): count and log errors while excluding the stopping context
-				if stopCtx.Err() == nil {
-					errorCnt := atomic.AddUint64(&k.errorCntr, 1)
-					ringbufmetrics.PerfEventErrors.Inc()
-					k.log.WithField("errors", errorCnt).WithError(err).Warn("Reading bpf events failed")
-				}
-			} else {
-				if len(record.RawSample) > 0 {
-					select {
-					case eventsQueue <- &record:
-					default:
-						// eventsQueue channel is full, drop the event
-						ringbufqueuemetrics.Lost.Inc()
-					}
-					k.recvCntr++
-					ringbufmetrics.PerfEventReceived.Inc()
-				}
-
-				if record.LostSamples > 0 {
-					atomic.AddUint64(&k.lostCntr, uint64(record.LostSamples))
-					ringbufmetrics.PerfEventLost.Add(float64(record.LostSamples))
-				}
+				return fmt.Errorf("reconfiguring ring buffer failed: %w", err)
 			}
+			currentRBSize = rbSize
+		case <-stopCtx.Done():
+			err := reader.Close()
+			genWG.Wait()
+			return err
 		}
-	}()
+	}
+}
 
-	// Start processing records from perf.
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
+// readEvents reads records from reader into queue until reader is closed
+// (by RunEvents, either to stop or to supersede it with a reconfigured
+// generation) or stopCtx is cancelled. It closes queue on exit so the
+// matching processEvents can drain and stop in turn.
+func (k *Observer) readEvents(stopCtx context.Context, reader bpfEventsReader, queue chan bpfRecord, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(queue)
+
+	for stopCtx.Err() == nil {
+		record, err := reader.Read()
+		if err != nil {
+			// NOTE(JM and Djalal): count and log errors while excluding the stopping context
+			if stopCtx.Err() == nil {
+				errorCnt := atomic.AddUint64(&k.errorCntr, 1)
+				ringbufmetrics.PerfEventErrors.Inc()
+				k.log.WithField("errors", errorCnt).WithError(err).Warn("Reading bpf events failed")
+			}
+			// A closed reader always surfaces as a read error, whether
+			// closed to stop or superseded by a reconfigure; either way
+			// there is nothing left to read from it.
+			return
+		}
+
+		if len(record.RawSample) > 0 {
 			select {
-			case event := <-eventsQueue:
-				k.receiveEvent(event.RawSample)
-				ringbufqueuemetrics.Received.Inc()
-			case <-stopCtx.Done():
-				k.log.WithError(stopCtx.Err()).Infof("Listening for events completed.")
-				k.log.Debugf("Unprocessed events in RB queue: %d", len(eventsQueue))
-				return
+			case queue <- record:
+			default:
+				// eventsQueue channel is full, drop the event
+				ringbufqueuemetrics.Lost.Inc()
+				atomic.AddUint64(&k.queueDropCntr, 1)
 			}
+			atomic.AddUint64(&k.recvCntr, 1)
+			ringbufmetrics.PerfEventReceived.Inc()
 		}
-	}()
 
-	// Loading default program consumes some memory lets kick GC to give
-	// this back to the OS (K8s).
-	go func() {
-		runtime.GC()
-	}()
+		if record.LostSamples > 0 {
+			atomic.AddUint64(&k.lostCntr, record.LostSamples)
+			ringbufmetrics.PerfEventLost.Add(float64(record.LostSamples))
+		}
+	}
+}
 
-	// Wait for context to be cancelled and then stop.
-	<-stopCtx.Done()
-	return perfReader.Close()
+// processEvents drains queue into receiveEvent until queue is closed by
+// its matching readEvents or stopCtx is cancelled.
+func (k *Observer) processEvents(stopCtx context.Context, queue chan bpfRecord, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case event, ok := <-queue:
+			if !ok {
+				return
+			}
+			k.receiveEvent(event.RawSample)
+			ringbufqueuemetrics.Received.Inc()
+		case <-stopCtx.Done():
+			k.log.WithError(stopCtx.Err()).Infof("Listening for events completed.")
+			k.log.Debugf("Unprocessed events in RB queue: %d", len(queue))
+			return
+		}
+	}
 }
 
 // Observer represents the link between the BPF perf ring and the listeners. It
@@ -311,11 +495,58 @@ type Observer struct {
 	recvCntr   uint64 // atomic
 	filterPass uint64
 	filterDrop uint64
+	// queueDropCntr counts events dropped because eventsQueue was full,
+	// i.e. backpressure loss. Unlike lostCntr (kernel-reported perf event
+	// array loss, never incremented by the ring buffer transport) this is
+	// incremented for both transports; WatchAutoGrow counts it alongside
+	// lostCntr.
+	queueDropCntr uint64 // atomic
 	/* Filters */
 	log logrus.FieldLogger
 
 	/* YAML Configuration File */
 	configFile string
+
+	/* Cgroup v2 correlation, see EnableCgroupResolution */
+	cgroupResolver cgroup.Resolver
+
+	/* Effective CPU count as seen by the container's cgroup, see Start */
+	effectiveCPUs int
+
+	/* Per-opcode rate limiting and sampling, see SetOpSampling */
+	sampler *sampling.Limiter
+
+	/* Pending ring-buffer/queue resizes, see Reconfigure */
+	reconfigCh chan reconfigRequest
+}
+
+// SetOpSampling installs per-opcode rate limiting and sampling in
+// receiveEvent, see pkg/observer/sampling. Passing a nil or empty cfg
+// disables sampling again.
+func (k *Observer) SetOpSampling(cfg map[uint8]sampling.OpConfig) {
+	if len(cfg) == 0 {
+		k.sampler = nil
+		return
+	}
+	k.sampler = sampling.NewLimiter(cfg)
+}
+
+// EnableCgroupResolution starts the cgroup v2 correlation subsystem rooted
+// at cgroupRoot (use cgroup.DefaultRoot unless overridden for testing) and
+// attaches it to k, so receiveEvent enriches events with Pod/Container/Unit
+// identity for as long as ctx stays alive.
+func (k *Observer) EnableCgroupResolution(ctx context.Context, cgroupRoot string) error {
+	resolver, err := cgroup.NewResolver(cgroupRoot)
+	if err != nil {
+		return fmt.Errorf("starting cgroup resolver failed: %w", err)
+	}
+
+	if err := resolver.Start(ctx); err != nil {
+		return fmt.Errorf("watching cgroup root %q failed: %w", cgroupRoot, err)
+	}
+
+	k.cgroupResolver = resolver
+	return nil
 }
 
 // UpdateRuntimeConf() Gathers information about Tetragon runtime environment and
@@ -343,8 +574,23 @@ func (k *Observer) UpdateRuntimeConf(mapDir string) error {
 
 // Start starts the observer
 func (k *Observer) Start(ctx context.Context) error {
+	// Tune GOMAXPROCS/GOMEMLIMIT to the container's cgroup limits before
+	// spinning up the perf/ring-buffer reader goroutines, so their sizing
+	// below reflects what's actually available rather than host resources.
+	k.effectiveCPUs = runtimetune.Apply()
+
 	k.PerfConfig = bpf.DefaultPerfEventConfig()
 
+	if option.Config.EnableCgroupV2Resolver {
+		if err := k.EnableCgroupResolution(ctx, cgroup.DefaultRoot); err != nil {
+			k.log.WithError(err).Warn("Enabling cgroup v2 correlation failed, continuing without it")
+		}
+	}
+
+	if len(option.Config.OpSampling) > 0 {
+		k.SetOpSampling(option.Config.OpSampling)
+	}
+
 	var err error
 	if err = k.RunEvents(ctx, func() {}); err != nil {
 		return fmt.Errorf("tetragon, aborting runtime error: %w", err)
@@ -366,6 +612,7 @@ func NewObserver(configFile string) *Observer {
 		listeners:  make(map[Listener]struct{}),
 		log:        logger.GetLogger(),
 		configFile: configFile,
+		reconfigCh: make(chan reconfigRequest),
 	}
 	observerList = append(observerList, o)
 	return o
@@ -392,6 +639,12 @@ func (k *Observer) ReadReceivedEvents() uint64 {
 	return atomic.LoadUint64(&k.recvCntr)
 }
 
+// ReadQueueDroppedEvents returns the number of events dropped because
+// eventsQueue was full, see queueDropCntr.
+func (k *Observer) ReadQueueDroppedEvents() uint64 {
+	return atomic.LoadUint64(&k.queueDropCntr)
+}
+
 func (k *Observer) PrintStats() {
 	recvCntr := k.ReadReceivedEvents()
 	lostCntr := k.ReadLostEvents()
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package observer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// reconfigRequest carries a pending ring-buffer/queue resize, consumed by
+// RunEvents' select loop and applied via a drain-and-swap (see spawn in
+// RunEvents) rather than a restart, so the current sensor set and
+// listeners are unaffected.
+type reconfigRequest struct {
+	rbSize    int
+	queueSize int
+}
+
+// Reconfigure queues a new per-unit ring buffer size and eventsQueue
+// length for RunEvents to apply, without dropping the current sensor set.
+// It is the mechanism behind both ReconfigureRingBuffer and WatchSIGHUP
+// below; it returns once the request has been handed to RunEvents, before
+// the swap itself completes.
+func (k *Observer) Reconfigure(ctx context.Context, rbSize, queueSize int) error {
+	if rbSize <= 0 || queueSize <= 0 {
+		return fmt.Errorf("ring buffer size and queue size must both be positive")
+	}
+
+	select {
+	case k.reconfigCh <- reconfigRequest{rbSize: rbSize, queueSize: queueSize}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReconfigureRingBufferRequest is the payload of the ReconfigureRingBuffer
+// control RPC, mirroring the shape a generated gRPC stub would carry for
+// it. This package defines no .proto and registers no gRPC service for
+// it; a gRPC server exposes the RPC by calling ReconfigureRingBuffer.
+type ReconfigureRingBufferRequest struct {
+	RBSize    int32
+	QueueSize int32
+}
+
+// ReconfigureRingBufferResponse is the (currently empty) response of the
+// ReconfigureRingBuffer control RPC.
+type ReconfigureRingBufferResponse struct{}
+
+// ReconfigureRingBuffer is the control API entry point for resizing the
+// ring buffer and eventsQueue at runtime, the gRPC counterpart to
+// WatchSIGHUP. It blocks until ctx is cancelled or the request has been
+// handed to RunEvents.
+func (k *Observer) ReconfigureRingBuffer(ctx context.Context, req *ReconfigureRingBufferRequest) (*ReconfigureRingBufferResponse, error) {
+	if err := k.Reconfigure(ctx, int(req.RBSize), int(req.QueueSize)); err != nil {
+		return nil, err
+	}
+	return &ReconfigureRingBufferResponse{}, nil
+}
+
+// WatchSIGHUP reconfigures the ring buffer and eventsQueue from the
+// current option.Config values whenever the process receives SIGHUP.
+// It does not reload the config file: it applies whatever sizes
+// option.Config holds at the time of the signal. cpus is the per-unit divisor RunEvents used to size the buffer, see
+// getRBSize. It runs until ctx is cancelled.
+func (k *Observer) WatchSIGHUP(ctx context.Context, cpus int) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-sigCh:
+				rbSize := k.getRBSize(cpus)
+				queueSize := k.getRBQueueSize()
+				if err := k.Reconfigure(ctx, rbSize, queueSize); err != nil {
+					k.log.WithError(err).Warn("SIGHUP reconfigure failed")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// AutoGrowConfig configures the feedback loop in WatchAutoGrow.
+type AutoGrowConfig struct {
+	// Interval between loss checks.
+	Interval time.Duration
+	// LossThreshold is the fraction (0..1) of events lost or dropped since
+	// the last check, out of all events seen in that time, that triggers a
+	// grow.
+	LossThreshold float64
+	// GrowthFactor multiplies the current per-unit size on each grow.
+	GrowthFactor float64
+	// Ceiling caps the per-unit size a grow can reach.
+	Ceiling int
+}
+
+// WatchAutoGrow periodically checks the fraction of events lost or dropped
+// since the last check and, once it crosses cfg.LossThreshold,
+// reconfigures the ring buffer to cfg.GrowthFactor times its current
+// per-unit size, up to cfg.Ceiling. It closes the loop that today
+// requires an operator to notice loss and reconfigure (or restart)
+// manually. cpus is the per-unit divisor RunEvents used to size the
+// initial buffer, see getRBSize. It runs until ctx is cancelled.
+//
+// Loss is read from both ReadLostEvents (kernel-reported perf event array
+// loss; always zero on the ring buffer transport, see ringbufEventsReader)
+// and ReadQueueDroppedEvents (eventsQueue backpressure), so backpressure
+// loss triggers a grow as well as kernel-reported loss. RunEvents does not
+// start WatchAutoGrow on a ring buffer, whose size is fixed at creation.
+func (k *Observer) WatchAutoGrow(ctx context.Context, cfg AutoGrowConfig, cpus int) {
+	currentSize := k.getRBSize(cpus)
+
+	ticker := time.NewTicker(cfg.Interval)
+	go func() {
+		defer ticker.Stop()
+
+		var lastRecv, lastLost, lastQueueDrop uint64
+		for {
+			select {
+			case <-ticker.C:
+				recv, lost, queueDrop := k.ReadReceivedEvents(), k.ReadLostEvents(), k.ReadQueueDroppedEvents()
+				dRecv, dLost, dQueueDrop := recv-lastRecv, lost-lastLost, queueDrop-lastQueueDrop
+				lastRecv, lastLost, lastQueueDrop = recv, lost, queueDrop
+
+				// recvCntr already counts records that were then dropped
+				// from a full eventsQueue, so only kernel loss adds to it.
+				dropped := dLost + dQueueDrop
+				total := dRecv + dLost
+				if total == 0 || currentSize >= cfg.Ceiling {
+					continue
+				}
+
+				loss := float64(dropped) / float64(total)
+				if loss < cfg.LossThreshold {
+					continue
+				}
+
+				nextSize := int(float64(currentSize) * cfg.GrowthFactor)
+				if nextSize > cfg.Ceiling {
+					nextSize = cfg.Ceiling
+				}
+				if nextSize <= currentSize {
+					continue
+				}
+
+				k.log.WithField("loss", loss).
+					WithField("from", currentSize).
+					WithField("to", nextSize).
+					Info("Auto-growing ring buffer size due to sustained loss")
+
+				if err := k.Reconfigure(ctx, nextSize, k.getRBQueueSize()); err != nil {
+					k.log.WithError(err).Warn("auto-grow reconfigure failed")
+					continue
+				}
+				currentSize = nextSize
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
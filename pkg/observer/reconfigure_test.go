@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package observer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBpfEventsReader is a bpfEventsReader that never touches a real BPF
+// map: Read returns one pending record if queued, then blocks until Close
+// is called, and Close records its own name so tests can assert ordering.
+type fakeBpfEventsReader struct {
+	name string
+
+	mu     sync.Mutex
+	closed bool
+
+	pending chan bpfRecord
+	done    chan struct{}
+
+	closeLog *[]string
+	closeMu  *sync.Mutex
+}
+
+func newFakeReader(name string, closeLog *[]string, closeMu *sync.Mutex) *fakeBpfEventsReader {
+	return &fakeBpfEventsReader{
+		name:     name,
+		pending:  make(chan bpfRecord, 1),
+		done:     make(chan struct{}),
+		closeLog: closeLog,
+		closeMu:  closeMu,
+	}
+}
+
+func (r *fakeBpfEventsReader) Read() (bpfRecord, error) {
+	select {
+	case rec := <-r.pending:
+		return rec, nil
+	case <-r.done:
+		return bpfRecord{}, errors.New("reader closed")
+	}
+}
+
+func (r *fakeBpfEventsReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+
+	r.closeMu.Lock()
+	*r.closeLog = append(*r.closeLog, r.name)
+	r.closeMu.Unlock()
+	return nil
+}
+
+// TestRunReconfigureLoopSwapsGenerations verifies that a reconfigure
+// request closes and drains the current generation before the next one is
+// spawned -- never two readers open on the same (simulated) map at once --
+// and that a record queued on the old generation before the swap is still
+// read rather than silently dropped by the swap.
+func TestRunReconfigureLoopSwapsGenerations(t *testing.T) {
+	k := &Observer{log: logrus.New(), reconfigCh: make(chan reconfigRequest, 1)}
+
+	var closeLog []string
+	var closeMu sync.Mutex
+
+	stopCtx, cancel := context.WithCancel(context.Background())
+
+	var spawnCount int
+	var spawnMu sync.Mutex
+	// gen1ClosedAtSpawn records, at the moment gen 2 is spawned, whether
+	// gen 1 had already been closed.
+	var gen1ClosedAtSpawn bool
+	spawn := func(rbSize, queueSize int) (bpfEventsReader, *sync.WaitGroup, error) {
+		spawnMu.Lock()
+		spawnCount++
+		gen := spawnCount
+		spawnMu.Unlock()
+
+		if gen == 2 {
+			closeMu.Lock()
+			gen1ClosedAtSpawn = len(closeLog) == 1 && closeLog[0] == "gen-1"
+			closeMu.Unlock()
+		}
+
+		reader := newFakeReader(genName(gen), &closeLog, &closeMu)
+		if gen == 1 {
+			// Queued before the swap; draining gen 1 must still deliver
+			// it to readEvents (reflected in recvCntr) rather than
+			// dropping it when the generation is superseded.
+			reader.pending <- bpfRecord{RawSample: []byte{0x2a}}
+		}
+
+		eventsQueue := make(chan bpfRecord, queueSize)
+		var genWG sync.WaitGroup
+		genWG.Add(2)
+		go k.readEvents(stopCtx, reader, eventsQueue, &genWG)
+		go k.processEvents(stopCtx, eventsQueue, &genWG)
+		return reader, &genWG, nil
+	}
+
+	reader, genWG, err := spawn(64, 64)
+	if err != nil {
+		t.Fatalf("initial spawn failed: %v", err)
+	}
+
+	loopErr := make(chan error, 1)
+	go func() {
+		loopErr <- k.runReconfigureLoop(stopCtx, false, 64, reader, genWG, spawn)
+	}()
+
+	// Give gen 1 a moment to actually read its queued record before
+	// triggering the swap, so this exercises drain, not a race where the
+	// record never had a chance to be read in the first place.
+	waitForCondition(t, func() bool { return k.ReadReceivedEvents() == 1 })
+
+	k.reconfigCh <- reconfigRequest{rbSize: 128, queueSize: 128}
+
+	waitForCondition(t, func() bool {
+		spawnMu.Lock()
+		defer spawnMu.Unlock()
+		return spawnCount == 2
+	})
+
+	cancel()
+	if err := <-loopErr; err != nil {
+		t.Fatalf("runReconfigureLoop returned error: %v", err)
+	}
+
+	closeMu.Lock()
+	defer closeMu.Unlock()
+	if !gen1ClosedAtSpawn || len(closeLog) < 1 || closeLog[0] != "gen-1" {
+		t.Fatalf("expected gen-1 to be closed before gen-2 started, closeLog = %v", closeLog)
+	}
+
+	if recv := k.ReadReceivedEvents(); recv != 1 {
+		t.Fatalf("record queued before the swap was not drained, recvCntr = %d", recv)
+	}
+}
+
+// TestRunReconfigureLoopIgnoresRingBufResize verifies that a resize
+// request for a ring-buffer-backed generation leaves rbSize unchanged,
+// since a BPF_MAP_TYPE_RINGBUF map's size can't actually change once it's
+// been created (see newBpfEventsReader).
+func TestRunReconfigureLoopIgnoresRingBufResize(t *testing.T) {
+	k := &Observer{log: logrus.New(), reconfigCh: make(chan reconfigRequest, 1)}
+
+	stopCtx, cancel := context.WithCancel(context.Background())
+
+	var closeLog []string
+	var closeMu sync.Mutex
+	var gotRBSize, spawnCount int
+	var rbSizeMu sync.Mutex
+
+	spawn := func(rbSize, queueSize int) (bpfEventsReader, *sync.WaitGroup, error) {
+		rbSizeMu.Lock()
+		gotRBSize = rbSize
+		spawnCount++
+		rbSizeMu.Unlock()
+
+		reader := newFakeReader("gen", &closeLog, &closeMu)
+		eventsQueue := make(chan bpfRecord, queueSize)
+		var genWG sync.WaitGroup
+		genWG.Add(2)
+		go k.readEvents(stopCtx, reader, eventsQueue, &genWG)
+		go k.processEvents(stopCtx, eventsQueue, &genWG)
+		return reader, &genWG, nil
+	}
+
+	reader, genWG, err := spawn(64, 64)
+	if err != nil {
+		t.Fatalf("initial spawn failed: %v", err)
+	}
+
+	loopErr := make(chan error, 1)
+	go func() {
+		loopErr <- k.runReconfigureLoop(stopCtx, true /* ringBuf */, 64, reader, genWG, spawn)
+	}()
+
+	k.reconfigCh <- reconfigRequest{rbSize: 4096, queueSize: 128}
+
+	waitForCondition(t, func() bool {
+		rbSizeMu.Lock()
+		defer rbSizeMu.Unlock()
+		return spawnCount == 2
+	})
+
+	cancel()
+	if err := <-loopErr; err != nil {
+		t.Fatalf("runReconfigureLoop returned error: %v", err)
+	}
+
+	rbSizeMu.Lock()
+	defer rbSizeMu.Unlock()
+	if gotRBSize != 64 {
+		t.Fatalf("ring buffer resize request was applied, got rbSize=%d, want unchanged 64", gotRBSize)
+	}
+}
+
+func genName(gen int) string {
+	if gen == 1 {
+		return "gen-1"
+	}
+	return "gen-2"
+}
+
+func waitForCondition(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("condition not met before deadline")
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package observer
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// bpfRecord is the subset of perf.Record/ringbuf.Record that RunEvents
+// needs, so the eventsQueue -> receiveEvent pipeline does not care whether
+// the underlying transport is a per-CPU perf event array or a single
+// shared BPF ring buffer.
+type bpfRecord struct {
+	RawSample   []byte
+	LostSamples uint64
+}
+
+// bpfEventsReader is implemented by the perf and ring buffer reader
+// wrappers below, letting RunEvents stay agnostic to the map type backing
+// k.PerfConfig.
+type bpfEventsReader interface {
+	Read() (bpfRecord, error)
+	Close() error
+}
+
+type perfEventsReader struct {
+	reader *perf.Reader
+}
+
+func (r *perfEventsReader) Read() (bpfRecord, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return bpfRecord{}, err
+	}
+	return bpfRecord{
+		RawSample:   record.RawSample,
+		LostSamples: uint64(record.LostSamples),
+	}, nil
+}
+
+func (r *perfEventsReader) Close() error {
+	return r.reader.Close()
+}
+
+type ringbufEventsReader struct {
+	reader *ringbuf.Reader
+}
+
+func (r *ringbufEventsReader) Read() (bpfRecord, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return bpfRecord{}, err
+	}
+	// The ring buffer is a single MPSC queue shared by all CPUs, so unlike
+	// the perf event array the kernel has no notion of per-record loss
+	// here; backpressure is only visible through eventsQueue.
+	return bpfRecord{RawSample: record.RawSample}, nil
+}
+
+func (r *ringbufEventsReader) Close() error {
+	return r.reader.Close()
+}
+
+// newBpfEventsReader opens the reader matching perfMap's actual BPF map
+// type (BPF_MAP_TYPE_RINGBUF or BPF_MAP_TYPE_PERF_EVENT_ARRAY). Choosing
+// which map type gets pinned at k.PerfConfig.MapName in the first place —
+// by config or by kernel version — is done by whatever loads the BPF
+// programs (pkg/bpf and the BPF map definitions themselves, neither of
+// which are touched here); this package only reacts to the result.
+// Observer can run against a ring buffer today if something upstream of it
+// pins one, but does not yet choose that for itself.
+func newBpfEventsReader(k *Observer, perfMap *ebpf.Map, rbSize int) (bpfEventsReader, error) {
+	if perfMap.Type() == ebpf.RingBuf {
+		k.log.Info("Using BPF ring buffer transport")
+		reader, err := ringbuf.NewReader(perfMap)
+		if err != nil {
+			return nil, fmt.Errorf("creating ring buffer reader failed: %w", err)
+		}
+		return &ringbufEventsReader{reader: reader}, nil
+	}
+
+	reader, err := perf.NewReader(perfMap, rbSize)
+	if err != nil {
+		return nil, fmt.Errorf("creating perf array reader failed: %w", err)
+	}
+	return &perfEventsReader{reader: reader}, nil
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package sampling implements per-opcode adaptive rate limiting for
+// Observer.receiveEvent. Under event storms (e.g. exec floods from CI
+// runners) it lets common, low-value ops be throttled by a token-bucket
+// limiter while rare ops keep passing through, instead of eventsQueue
+// dropping uniformly across opcodes once it fills.
+package sampling
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// decayPerThrottledEvent/recoveryPerAllowedEvent control how fast the
+// exponential sampler backs off once the token bucket runs dry, and how
+// fast it recovers once the bucket has tokens again.
+const (
+	decayPerThrottledEvent  = 0.98
+	recoveryPerAllowedEvent = 1.01
+)
+
+// OpConfig configures sampling for a single opcode.
+type OpConfig struct {
+	// Rate is the steady-state number of events per second allowed
+	// through the token bucket before the exponential sampler engages.
+	Rate float64
+	// Burst is the token bucket capacity.
+	Burst float64
+	// MinSampleRatio floors how aggressively the exponential sampler
+	// backs off under sustained pressure (e.g. 0.01 keeps at least 1%
+	// of events flowing even during a storm).
+	MinSampleRatio float64
+}
+
+// Stats are the effective sampling numbers for one opcode.
+type Stats struct {
+	Sampled uint64
+	Dropped uint64
+}
+
+// Ratio returns the fraction of events that passed the limiter.
+func (s Stats) Ratio() float64 {
+	total := s.Sampled + s.Dropped
+	if total == 0 {
+		return 1
+	}
+	return float64(s.Sampled) / float64(total)
+}
+
+type opState struct {
+	mu sync.Mutex
+
+	cfg OpConfig
+
+	tokens   float64
+	lastFill time.Time
+
+	// sampleRatio is the exponential sampler's current pass-through
+	// ratio; it decays towards cfg.MinSampleRatio while the token bucket
+	// stays empty and recovers back to 1 once events are flowing again.
+	sampleRatio float64
+
+	stats Stats
+}
+
+func newOpState(cfg OpConfig) *opState {
+	return &opState{
+		cfg:         cfg,
+		tokens:      cfg.Burst,
+		lastFill:    time.Now(),
+		sampleRatio: 1,
+	}
+}
+
+// allow decides whether one event should be processed, updating stats and
+// the exponential sampler's ratio either way.
+func (s *opState) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.Rate <= 0 && s.cfg.Burst <= 0 {
+		// Unconfigured opcode: pass through unthrottled.
+		s.stats.Sampled++
+		return true
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(s.lastFill).Seconds()
+	s.lastFill = now
+	s.tokens += elapsed * s.cfg.Rate
+	if s.tokens > s.cfg.Burst {
+		s.tokens = s.cfg.Burst
+	}
+
+	if s.tokens >= 1 {
+		s.tokens--
+		s.sampleRatio *= recoveryPerAllowedEvent
+		if s.sampleRatio > 1 {
+			s.sampleRatio = 1
+		}
+		s.stats.Sampled++
+		return true
+	}
+
+	floor := s.cfg.MinSampleRatio
+	if floor < 0 {
+		floor = 0
+	}
+	s.sampleRatio *= decayPerThrottledEvent
+	if s.sampleRatio < floor {
+		s.sampleRatio = floor
+	}
+
+	if rand.Float64() < s.sampleRatio {
+		s.stats.Sampled++
+		return true
+	}
+
+	s.stats.Dropped++
+	return false
+}
+
+func (s *opState) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *opState) ratio() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sampleRatio
+}
+
+// Limiter rate-limits and samples events on a per-opcode basis.
+type Limiter struct {
+	mu  sync.Mutex
+	cfg map[uint8]OpConfig
+	ops map[uint8]*opState
+}
+
+// NewLimiter builds a Limiter from a per-opcode configuration, typically
+// sourced from option.Config via Observer.SetOpSampling. Opcodes absent
+// from cfg pass through unthrottled.
+func NewLimiter(cfg map[uint8]OpConfig) *Limiter {
+	return &Limiter{
+		cfg: cfg,
+		ops: make(map[uint8]*opState),
+	}
+}
+
+// Allow reports whether an event for op should be processed, updating that
+// opcode's sampled/dropped counters either way.
+func (l *Limiter) Allow(op uint8) bool {
+	return l.state(op).allow()
+}
+
+// Stats returns the effective sampled/dropped counts for op.
+func (l *Limiter) Stats(op uint8) Stats {
+	return l.state(op).snapshot()
+}
+
+// Ratio returns op's current pass-through ratio, for listeners that want
+// to extrapolate counts from what they actually received.
+func (l *Limiter) Ratio(op uint8) float64 {
+	return l.state(op).ratio()
+}
+
+func (l *Limiter) state(op uint8) *opState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.ops[op]
+	if !ok {
+		s = newOpState(l.cfg[op])
+		l.ops[op] = s
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package sampling
+
+import "testing"
+
+func TestLimiterUnconfiguredPassesThrough(t *testing.T) {
+	l := NewLimiter(nil)
+	for i := 0; i < 100; i++ {
+		if !l.Allow(1) {
+			t.Fatalf("unconfigured opcode was throttled on call %d", i)
+		}
+	}
+	if stats := l.Stats(1); stats.Dropped != 0 {
+		t.Fatalf("unconfigured opcode recorded drops: %+v", stats)
+	}
+}
+
+func TestLimiterBurstThenThrottle(t *testing.T) {
+	l := NewLimiter(map[uint8]OpConfig{
+		1: {Rate: 0, Burst: 3, MinSampleRatio: 0},
+	})
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow(1) {
+			t.Fatalf("call %d: expected burst tokens to allow event", i)
+		}
+	}
+
+	// Burst is exhausted and Rate is 0, so the token bucket never
+	// refills; with MinSampleRatio of 0 the exponential sampler's
+	// pass-through ratio shrinks by decayPerThrottledEvent on every
+	// throttled event (to about 0.36 after 50), so some of them are dropped.
+	for i := 0; i < 50; i++ {
+		l.Allow(1)
+	}
+
+	stats := l.Stats(1)
+	if stats.Dropped == 0 {
+		t.Fatalf("expected drops once burst was exhausted, got %+v", stats)
+	}
+	if ratio := l.Ratio(1); ratio >= 1 {
+		t.Fatalf("expected sample ratio to have decayed below 1, got %v", ratio)
+	}
+}
+
+func TestLimiterIndependentPerOpcode(t *testing.T) {
+	l := NewLimiter(map[uint8]OpConfig{
+		1: {Rate: 0, Burst: 1, MinSampleRatio: 0},
+	})
+
+	l.Allow(1)
+	for i := 0; i < 20; i++ {
+		l.Allow(1)
+	}
+
+	// Opcode 2 has no configuration entry, so it must stay unthrottled
+	// even though opcode 1's bucket is empty.
+	for i := 0; i < 20; i++ {
+		if !l.Allow(2) {
+			t.Fatalf("call %d: unconfigured opcode 2 was throttled by opcode 1's state", i)
+		}
+	}
+}
+
+func TestStatsRatio(t *testing.T) {
+	s := Stats{Sampled: 3, Dropped: 1}
+	if got := s.Ratio(); got != 0.75 {
+		t.Fatalf("Ratio() = %v, want 0.75", got)
+	}
+	if got := (Stats{}).Ratio(); got != 1 {
+		t.Fatalf("Ratio() on zero Stats = %v, want 1", got)
+	}
+}
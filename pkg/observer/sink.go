@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package observer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/metrics/ringbufqueuemetrics"
+	"github.com/cilium/tetragon/pkg/reader/notify"
+)
+
+// SinkBackend is implemented by concrete transports (Kafka, NATS
+// JetStream, a bidirectional gRPC stream, see pkg/observer/sinks) that a
+// Sink batches events into. It is intentionally narrower than Listener:
+// backends only ship already-batched payloads, batching, backpressure and
+// retry are handled by Sink itself.
+type SinkBackend interface {
+	// Send delivers a batch of events, returning an error if any of them
+	// could not be accepted. Sink then retries the whole batch, so events
+	// already accepted may be delivered more than once.
+	Send(ctx context.Context, events []notify.Message) error
+	Close() error
+}
+
+// SinkConfig configures the batching/backpressure/retry behavior common to
+// every Sink, independent of the backend it writes to. sinks.LoadFromFile
+// builds one from each `sinks:` entry of a YAML file and calls
+// Observer.AddSink for it; Observer itself does not read sinks from
+// k.configFile. Callers that build a backend directly (e.g. tests) can
+// also construct one by hand.
+type SinkConfig struct {
+	// Name identifies this sink in logs.
+	Name string
+	// BatchSize is the number of events buffered before Send is called.
+	BatchSize int
+	// FlushInterval forces a Send even if BatchSize hasn't been reached.
+	FlushInterval time.Duration
+	// MaxRetries bounds how many times a failed batch is retried before
+	// it is dropped.
+	MaxRetries int
+	// RetryDelay is the pause between retries of a failed batch.
+	RetryDelay time.Duration
+	// FlushTimeout bounds the final flush Close does on shutdown, since by
+	// that point s.stop is already cancelled and can no longer be used to
+	// give the backend room to accept the last batch.
+	FlushTimeout time.Duration
+}
+
+func (cfg *SinkConfig) setDefaults() {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 128
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 100 * time.Millisecond
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = 5 * time.Second
+	}
+}
+
+// Sink adapts a SinkBackend to the Listener interface, giving operators a
+// supported way to fan Tetragon events out to external streaming
+// infrastructure without writing a custom exporter. Notify never blocks: a
+// saturated sink drops the event and increments ringbufqueuemetrics.Lost,
+// the same backpressure signal eventsQueue itself uses, so a slow sink
+// cannot stall receiveEvent.
+type Sink struct {
+	cfg     SinkConfig
+	backend SinkBackend
+
+	events chan notify.Message
+	cancel context.CancelFunc
+	stop   context.Context
+	wg     sync.WaitGroup
+
+	log logrus.FieldLogger
+}
+
+// NewSink starts a Sink that batches events into backend according to cfg.
+func NewSink(cfg SinkConfig, backend SinkBackend) *Sink {
+	cfg.setDefaults()
+
+	stop, cancel := context.WithCancel(context.Background())
+	s := &Sink{
+		cfg:     cfg,
+		backend: backend,
+		events:  make(chan notify.Message, cfg.BatchSize*4),
+		stop:    stop,
+		cancel:  cancel,
+		log:     logger.GetLogger().WithField("sink", cfg.Name),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// AddSink wraps backend in a Sink and registers it as a Listener, so it
+// receives the same events as any in-process Listener.
+func (k *Observer) AddSink(cfg SinkConfig, backend SinkBackend) {
+	k.AddListener(NewSink(cfg, backend))
+}
+
+// Notify implements Listener.
+func (s *Sink) Notify(msg notify.Message) error {
+	select {
+	case s.events <- msg:
+	default:
+		ringbufqueuemetrics.Lost.Inc()
+	}
+	return nil
+}
+
+// Close implements Listener, flushing any buffered events before closing
+// the backend.
+func (s *Sink) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return s.backend.Close()
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+
+	batch := make([]notify.Message, 0, s.cfg.BatchSize)
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		// A batch interrupted by ctx is kept for the final flush.
+		if s.send(ctx, batch) {
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case event := <-s.events:
+			batch = append(batch, event)
+			if len(batch) >= s.cfg.BatchSize {
+				flush(s.stop)
+			}
+		case <-ticker.C:
+			flush(s.stop)
+		case <-s.stop.Done():
+			// A Notify racing with Close can land its event in s.events
+			// after this select last drained it, making that case and
+			// this one ready together; select then picks between them
+			// at random, so drain whatever is already buffered before
+			// flushing or it could be lost.
+			for drained := false; !drained; {
+				select {
+				case event := <-s.events:
+					batch = append(batch, event)
+				default:
+					drained = true
+				}
+			}
+
+			// s.stop is cancelled by the time we get here, so it can no
+			// longer carry a send to completion; give the final flush its
+			// own bounded-timeout context instead of dropping the last
+			// batch outright.
+			finalCtx, cancel := context.WithTimeout(context.Background(), s.cfg.FlushTimeout)
+			flush(finalCtx)
+			cancel()
+			if len(batch) > 0 {
+				s.log.WithField("dropped", len(batch)).Warn("sink final flush timed out, dropping batch")
+				ringbufqueuemetrics.Lost.Add(float64(len(batch)))
+			}
+			return
+		}
+	}
+}
+
+// send delivers batch to the backend with retry, giving the sink
+// at-least-once semantics: a batch is only dropped after MaxRetries
+// attempts have all failed (or, on Close, once the final flush runs out of
+// FlushTimeout), at which point it counts as queue loss just like a full
+// eventsQueue does. send returns false, leaving the batch with the caller,
+// if ctx ends while it waits to retry; otherwise it returns true.
+func (s *Sink) send(ctx context.Context, batch []notify.Message) bool {
+	events := make([]notify.Message, len(batch))
+	copy(events, batch)
+
+	for attempt := 0; attempt <= s.cfg.MaxRetries; attempt++ {
+		err := s.backend.Send(ctx, events)
+		if err == nil {
+			return true
+		}
+
+		if attempt == s.cfg.MaxRetries {
+			s.log.WithError(err).WithField("dropped", len(events)).Warn("sink exhausted retries, dropping batch")
+			ringbufqueuemetrics.Lost.Add(float64(len(events)))
+			return true
+		}
+
+		s.log.WithError(err).WithField("attempt", attempt+1).Debug("sink send failed, retrying")
+		select {
+		case <-time.After(s.cfg.RetryDelay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
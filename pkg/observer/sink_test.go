@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package observer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/reader/notify"
+)
+
+// fakeSinkBackend is a SinkBackend that records every batch it's asked to
+// send. failNext, if set, makes the next N Send calls fail (simulating a
+// transport hiccup) before succeeding, so tests can exercise Sink's retry
+// and retry-exhaustion paths.
+type fakeSinkBackend struct {
+	mu       sync.Mutex
+	batches  [][]notify.Message
+	failNext int
+	closed   bool
+}
+
+func (b *fakeSinkBackend) Send(_ context.Context, events []notify.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failNext > 0 {
+		b.failNext--
+		return errors.New("backend unavailable")
+	}
+	batch := make([]notify.Message, len(events))
+	copy(batch, events)
+	b.batches = append(b.batches, batch)
+	return nil
+}
+
+func (b *fakeSinkBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *fakeSinkBackend) sent() [][]notify.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([][]notify.Message, len(b.batches))
+	copy(out, b.batches)
+	return out
+}
+
+func (b *fakeSinkBackend) wasClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+type fakeMessage struct{ notify.Message }
+
+func TestSinkFlushesOnBatchSize(t *testing.T) {
+	backend := &fakeSinkBackend{}
+	s := NewSink(SinkConfig{
+		Name:          "test",
+		BatchSize:     2,
+		FlushInterval: time.Hour, // long enough to not fire during the test
+	}, backend)
+	defer s.Close()
+
+	s.Notify(fakeMessage{})
+	s.Notify(fakeMessage{})
+
+	waitForSinkCondition(t, func() bool { return len(backend.sent()) == 1 })
+
+	if got := len(backend.sent()[0]); got != 2 {
+		t.Fatalf("batch size trigger sent %d events, want 2", got)
+	}
+}
+
+func TestSinkFlushesOnInterval(t *testing.T) {
+	backend := &fakeSinkBackend{}
+	s := NewSink(SinkConfig{
+		Name:          "test",
+		BatchSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+	}, backend)
+	defer s.Close()
+
+	s.Notify(fakeMessage{})
+
+	waitForSinkCondition(t, func() bool { return len(backend.sent()) == 1 })
+
+	if got := len(backend.sent()[0]); got != 1 {
+		t.Fatalf("interval trigger sent %d events, want 1", got)
+	}
+}
+
+func TestSinkRetriesThenSucceeds(t *testing.T) {
+	backend := &fakeSinkBackend{failNext: 2}
+	s := NewSink(SinkConfig{
+		Name:          "test",
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+		RetryDelay:    time.Millisecond,
+	}, backend)
+	defer s.Close()
+
+	s.Notify(fakeMessage{})
+
+	waitForSinkCondition(t, func() bool { return len(backend.sent()) == 1 })
+}
+
+func TestSinkDropsAfterRetriesExhausted(t *testing.T) {
+	backend := &fakeSinkBackend{failNext: 100}
+	s := NewSink(SinkConfig{
+		Name:          "test",
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		MaxRetries:    1,
+		RetryDelay:    time.Millisecond,
+	}, backend)
+
+	s.Notify(fakeMessage{})
+
+	// Give send() time to exhaust its retries; the batch is dropped, not
+	// requeued, so sent() should stay empty even after Close's final flush.
+	time.Sleep(50 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := len(backend.sent()); got != 0 {
+		t.Fatalf("got %d successful batches, want 0 (all retries should have been exhausted)", got)
+	}
+}
+
+// TestSinkFlushesFinalBatchOnClose verifies the fix carried over from the
+// earlier sink/ctx review round: a batch still buffered when Close is
+// called is flushed with its own bounded-timeout context rather than being
+// silently dropped because s.stop is already cancelled.
+func TestSinkFlushesFinalBatchOnClose(t *testing.T) {
+	backend := &fakeSinkBackend{}
+	s := NewSink(SinkConfig{
+		Name:          "test",
+		BatchSize:     100, // never reached by the single Notify below
+		FlushInterval: time.Hour,
+		FlushTimeout:  time.Second,
+	}, backend)
+
+	s.Notify(fakeMessage{})
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	sent := backend.sent()
+	if len(sent) != 1 || len(sent[0]) != 1 {
+		t.Fatalf("final buffered batch was not flushed on Close, sent = %v", sent)
+	}
+	if !backend.wasClosed() {
+		t.Fatalf("backend was not closed")
+	}
+}
+
+func waitForSinkCondition(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("condition not met before deadline")
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package sinks
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cilium/tetragon/pkg/observer"
+)
+
+// FileConfig is the shape of the `sinks:` section of a Tetragon config
+// file, letting operators declare Kafka/NATS/gRPC sinks in YAML instead of
+// calling Observer.AddSink from Go.
+type FileConfig struct {
+	Sinks []SinkEntry `yaml:"sinks"`
+}
+
+// SinkEntry is one `sinks:` entry. Type selects which backend-specific
+// field is used; the rest configure the observer.Sink wrapping it.
+type SinkEntry struct {
+	Name          string        `yaml:"name"`
+	Type          string        `yaml:"type"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	MaxRetries    int           `yaml:"maxRetries"`
+	RetryDelay    time.Duration `yaml:"retryDelay"`
+	FlushTimeout  time.Duration `yaml:"flushTimeout"`
+
+	Kafka KafkaConfig `yaml:"kafka"`
+	NATS  NATSConfig  `yaml:"nats"`
+}
+
+// LoadFromFile reads path, normally the same file passed to
+// observer.NewObserver as configFile, and registers every `sinks:` entry
+// on k via Observer.AddSink. gRPC sinks are not loadable this way: a
+// gRPC stream needs a caller-supplied newStream constructor
+// (NewGRPCBackend) that a YAML value cannot express, so entries
+// of that type are rejected rather than silently skipped.
+func LoadFromFile(k *observer.Observer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading sink config %q failed: %w", path, err)
+	}
+
+	var fc FileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("parsing sink config %q failed: %w", path, err)
+	}
+
+	for _, entry := range fc.Sinks {
+		cfg := observer.SinkConfig{
+			Name:          entry.Name,
+			BatchSize:     entry.BatchSize,
+			FlushInterval: entry.FlushInterval,
+			MaxRetries:    entry.MaxRetries,
+			RetryDelay:    entry.RetryDelay,
+			FlushTimeout:  entry.FlushTimeout,
+		}
+
+		switch entry.Type {
+		case "kafka":
+			k.AddSink(cfg, NewKafkaBackend(entry.Kafka))
+		case "nats":
+			backend, err := NewNATSBackend(entry.NATS)
+			if err != nil {
+				return fmt.Errorf("configuring nats sink %q failed: %w", entry.Name, err)
+			}
+			k.AddSink(cfg, backend)
+		case "grpc":
+			return fmt.Errorf("sink %q: type %q cannot be configured from YAML, call sinks.NewGRPCBackend and Observer.AddSink directly", entry.Name, entry.Type)
+		default:
+			return fmt.Errorf("sink %q: unknown type %q", entry.Name, entry.Type)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	"github.com/cilium/tetragon/pkg/reader/notify"
+)
+
+// EventStreamClient is the client side of a bidirectional gRPC stream that
+// ships JSON-encoded Tetragon events, matching the shape generated by a
+// `stream bytes` RPC. grpcBackend is deliberately decoupled from any one
+// .proto definition so it can front whatever stream service a deployment
+// generates for its own collector.
+type EventStreamClient interface {
+	Send(data []byte) error
+	CloseSend() error
+}
+
+// grpcBackend implements observer.SinkBackend over a bidirectional gRPC
+// stream. Each event is marshaled to JSON and sent as one stream message.
+type grpcBackend struct {
+	conn   *grpc.ClientConn
+	stream EventStreamClient
+}
+
+// NewGRPCBackend dials target and opens a stream via newStream, returning
+// a backend ready to be wrapped in an observer.Sink.
+func NewGRPCBackend(target string, newStream func(*grpc.ClientConn) (EventStreamClient, error), opts ...grpc.DialOption) (*grpcBackend, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dialing grpc sink %q failed: %w", target, err)
+	}
+
+	stream, err := newStream(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening grpc event stream failed: %w", err)
+	}
+
+	return &grpcBackend{conn: conn, stream: stream}, nil
+}
+
+// Send implements observer.SinkBackend. EventStreamClient.Send has no
+// context of its own, so a stream wedged on a dead connection would
+// otherwise block Send (and the Sink goroutine calling it) indefinitely;
+// sendOne runs it on a separate goroutine and gives up once ctx is done.
+func (b *grpcBackend) Send(ctx context.Context, events []notify.Message) error {
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("marshaling event for grpc stream failed: %w", err)
+		}
+		if err := b.sendOne(ctx, data); err != nil {
+			return fmt.Errorf("sending to grpc stream failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *grpcBackend) sendOne(ctx context.Context, data []byte) error {
+	done := make(chan error, 1)
+	go func() { done <- b.stream.Send(data) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close implements observer.SinkBackend.
+func (b *grpcBackend) Close() error {
+	if err := b.stream.CloseSend(); err != nil {
+		b.conn.Close()
+		return fmt.Errorf("closing grpc stream failed: %w", err)
+	}
+	return b.conn.Close()
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package sinks provides observer.SinkBackend implementations that ship
+// Tetragon events to external streaming infrastructure: Kafka, NATS
+// JetStream, and a bidirectional gRPC stream.
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	kafka "github.com/segmentio/kafka-go"
+
+	"github.com/cilium/tetragon/pkg/reader/notify"
+)
+
+// KafkaConfig configures a Kafka backend.
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+}
+
+// kafkaBackend implements observer.SinkBackend over a Kafka topic. Each
+// event is marshaled to JSON and produced as one Kafka message.
+type kafkaBackend struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaBackend returns a backend that produces to cfg.Topic on
+// cfg.Brokers, ready to be wrapped in an observer.Sink.
+func NewKafkaBackend(cfg KafkaConfig) *kafkaBackend {
+	return &kafkaBackend{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(cfg.Brokers...),
+			Topic:    cfg.Topic,
+			Balancer: &kafka.LeastBytes{},
+		},
+	}
+}
+
+// Send implements observer.SinkBackend.
+func (b *kafkaBackend) Send(ctx context.Context, events []notify.Message) error {
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("marshaling event for kafka failed: %w", err)
+		}
+		msgs = append(msgs, kafka.Message{Value: data})
+	}
+	return b.writer.WriteMessages(ctx, msgs...)
+}
+
+// Close implements observer.SinkBackend.
+func (b *kafkaBackend) Close() error {
+	return b.writer.Close()
+}
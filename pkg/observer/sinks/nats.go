@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/cilium/tetragon/pkg/reader/notify"
+)
+
+// NATSConfig configures a NATS JetStream backend.
+type NATSConfig struct {
+	URL     string `yaml:"url"`
+	Subject string `yaml:"subject"`
+}
+
+// natsBackend implements observer.SinkBackend over a NATS JetStream
+// subject. Each event is marshaled to JSON and published as one message;
+// JetStream acknowledgment gives the sink at-least-once delivery.
+type natsBackend struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+// NewNATSBackend connects to cfg.URL and returns a backend that publishes
+// to cfg.Subject, ready to be wrapped in an observer.Sink.
+func NewNATSBackend(cfg NATSConfig) (*natsBackend, error) {
+	conn, err := nats.Connect(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to nats %q failed: %w", cfg.URL, err)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("acquiring jetstream context failed: %w", err)
+	}
+
+	return &natsBackend{conn: conn, js: js, subject: cfg.Subject}, nil
+}
+
+// Send implements observer.SinkBackend.
+func (b *natsBackend) Send(ctx context.Context, events []notify.Message) error {
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("marshaling event for nats failed: %w", err)
+		}
+		if _, err := b.js.Publish(b.subject, data, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("publishing to nats subject %q failed: %w", b.subject, err)
+		}
+	}
+	return nil
+}
+
+// Close implements observer.SinkBackend.
+func (b *natsBackend) Close() error {
+	b.conn.Close()
+	return nil
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package runtimetune adjusts Go runtime defaults (GOMAXPROCS, GOMEMLIMIT)
+// to the CPU and memory limits of the cgroup Tetragon is running in. Inside
+// a container, runtime.NumCPU() and the Go GC's default memory target both
+// reflect host resources, which causes goroutine oversubscription and OOMs
+// under load once the container's cgroup limits are smaller than the host.
+package runtimetune
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/tetragon/pkg/logger"
+)
+
+const (
+	cgroupV2Root   = "/sys/fs/cgroup"
+	procSelfCgroup = "/proc/self/cgroup"
+)
+
+// Apply inspects cpu.max and memory.max in the current cgroup and sets
+// GOMAXPROCS and GOMEMLIMIT accordingly, unless the operator already set
+// the GOMAXPROCS/GOMEMLIMIT environment variables. It returns the
+// effective CPU count so callers can size per-CPU resources, such as
+// Observer.getRBSize, off the cgroup limit rather than runtime.NumCPU().
+func Apply() int {
+	log := logger.GetLogger()
+
+	root := cgroupPath(procSelfCgroup, cgroupV2Root)
+
+	cpus := runtime.NumCPU()
+	if quota, ok, err := cpuQuota(root); err != nil {
+		log.WithError(err).Debug("reading cgroup cpu.max failed")
+	} else if ok {
+		cpus = int(math.Ceil(quota))
+		if cpus < 1 {
+			cpus = 1
+		}
+		if _, overridden := os.LookupEnv("GOMAXPROCS"); !overridden {
+			runtime.GOMAXPROCS(cpus)
+			log.WithField("gomaxprocs", cpus).Info("Tuned GOMAXPROCS from cgroup cpu.max")
+		}
+	}
+
+	if _, overridden := os.LookupEnv("GOMEMLIMIT"); !overridden {
+		if limit, ok, err := memoryLimit(root); err != nil {
+			log.WithError(err).Debug("reading cgroup memory.max failed")
+		} else if ok {
+			debug.SetMemoryLimit(limit)
+			log.WithField("gomemlimit", limit).Info("Tuned GOMEMLIMIT from cgroup memory.max")
+		}
+	}
+
+	return cpus
+}
+
+// cgroupPath resolves the cgroupfs directory that holds this process's
+// own cpu.max/memory.max, by joining the unified (cgroup v2) entry in
+// procCgroupFile onto root. Without this, cpuQuota/memoryLimit would read
+// root's own cpu.max/memory.max, which is the host- or node-wide limit,
+// not the (usually much smaller) limit placed on this container. Falls
+// back to root itself if procCgroupFile can't be read or has no unified
+// entry, so a process already running at the cgroupfs root still gets a
+// best-effort answer instead of an error.
+func cgroupPath(procCgroupFile, root string) string {
+	data, err := os.ReadFile(procCgroupFile)
+	if err != nil {
+		return root
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// A cgroup v2 unified hierarchy entry has the form
+		// "0::<path-relative-to-root>"; v1 hybrid entries use a
+		// nonzero hierarchy ID and a comma-separated controller list
+		// before the second colon, which we're not interested in here.
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[0] != "0" || fields[1] != "" {
+			continue
+		}
+		return filepath.Join(root, fields[2])
+	}
+
+	return root
+}
+
+// cpuQuota returns the effective number of CPUs allowed by root's cpu.max
+// (quota / period), or ok == false when the cgroup has no CPU limit
+// ("max").
+func cpuQuota(root string) (cpus float64, ok bool, err error) {
+	data, err := os.ReadFile(filepath.Join(root, "cpu.max"))
+	if err != nil {
+		return 0, false, err
+	}
+
+	fields := strings.Fields(strings.TrimSpace(string(data)))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false, nil
+	}
+
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing cpu.max quota failed: %w", err)
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period == 0 {
+		return 0, false, fmt.Errorf("parsing cpu.max period failed: %w", err)
+	}
+
+	return quota / period, true, nil
+}
+
+// memoryLimit returns root's memory.max in bytes, or ok == false when the
+// cgroup has no memory limit ("max").
+func memoryLimit(root string) (limit int64, ok bool, err error) {
+	f, err := os.Open(filepath.Join(root, "memory.max"))
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, false, scanner.Err()
+	}
+
+	value := strings.TrimSpace(scanner.Text())
+	if value == "max" {
+		return 0, false, nil
+	}
+
+	limit, err = strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing memory.max failed: %w", err)
+	}
+
+	return limit, true, nil
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package runtimetune
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupPath(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "unified v2 entry",
+			content: "0::/kubepods.slice/pod1234/container5678\n",
+			want:    filepath.Join(root, "kubepods.slice/pod1234/container5678"),
+		},
+		{
+			name:    "unified v2 entry at root",
+			content: "0::/\n",
+			want:    root,
+		},
+		{
+			name:    "no unified entry",
+			content: "1:cpu,cpuacct:/kubepods.slice\n",
+			want:    root,
+		},
+		{
+			name:    "empty file",
+			content: "",
+			want:    root,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), "cgroup")
+			if err := os.WriteFile(f, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("writing fixture failed: %v", err)
+			}
+			if got := cgroupPath(f, root); got != tt.want {
+				t.Errorf("cgroupPath(%q, %q) = %q, want %q", f, root, got, tt.want)
+			}
+		})
+	}
+
+	if got := cgroupPath(filepath.Join(root, "missing"), root); got != root {
+		t.Errorf("cgroupPath with unreadable file = %q, want fallback %q", got, root)
+	}
+}
+
+func TestCPUQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantQuota float64
+		wantOK    bool
+		wantErr   bool
+	}{
+		{name: "limited", content: "200000 100000\n", wantQuota: 2, wantOK: true},
+		{name: "unlimited", content: "max 100000\n", wantOK: false},
+		{name: "malformed", content: "not-a-number 100000\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("writing fixture failed: %v", err)
+			}
+
+			quota, ok, err := cpuQuota(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cpuQuota() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("cpuQuota() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && quota != tt.wantQuota {
+				t.Fatalf("cpuQuota() = %v, want %v", quota, tt.wantQuota)
+			}
+		})
+	}
+
+	if _, _, err := cpuQuota(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("cpuQuota() on missing cpu.max: expected error")
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantLimit int64
+		wantOK    bool
+		wantErr   bool
+	}{
+		{name: "limited", content: "536870912\n", wantLimit: 536870912, wantOK: true},
+		{name: "unlimited", content: "max\n", wantOK: false},
+		{name: "malformed", content: "not-a-number\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("writing fixture failed: %v", err)
+			}
+
+			limit, ok, err := memoryLimit(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("memoryLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("memoryLimit() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && limit != tt.wantLimit {
+				t.Fatalf("memoryLimit() = %v, want %v", limit, tt.wantLimit)
+			}
+		})
+	}
+
+	if _, _, err := memoryLimit(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("memoryLimit() on missing memory.max: expected error")
+	}
+}